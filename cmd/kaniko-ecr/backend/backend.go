@@ -0,0 +1,56 @@
+// Package backend abstracts the OCI image builder invoked by the plugin so that operators can
+// swap kaniko for an alternative builder (buildkit, img) depending on cluster constraints such as
+// rootless execution or the lack of /dev/fuse.
+package backend
+
+import "context"
+
+// Options carries the build parameters the plugin already derives from its CLI flags, translated
+// into backend-specific arguments by each Backend implementation.
+type Options struct {
+	Dockerfile   string
+	Context      string
+	Tags         []string
+	Args         []string
+	Target       string
+	Repo         string
+	CacheRepo    string
+	CacheTTL     int
+	SnapshotMode string
+	Labels       []string
+	NoPush       bool
+	Verbosity    string
+	DigestFile   string
+}
+
+// Result is what every backend reports back once the build (and, unless NoPush was set, push)
+// completes, so the caller can emit a backend-agnostic artifact file.
+type Result struct {
+	Digest string
+	Tags   []string
+}
+
+// Backend builds (and pushes) an image from Options.
+type Backend interface {
+	Build(ctx context.Context, opts Options) (Result, error)
+}
+
+// New resolves the backend selected via the --builder flag.
+func New(name string) (Backend, error) {
+	switch name {
+	case "", "kaniko":
+		return &Kaniko{}, nil
+	case "buildkit":
+		return &Buildkit{}, nil
+	case "img":
+		return &Img{}, nil
+	default:
+		return nil, unsupportedBuilderError(name)
+	}
+}
+
+type unsupportedBuilderError string
+
+func (e unsupportedBuilderError) Error() string {
+	return "unsupported builder: " + string(e)
+}
@@ -0,0 +1,106 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Buildkit drives a buildkitd sidecar via buildctl. It is useful in clusters where kaniko's
+// fuse-overlayfs snapshotter isn't available but a rootless buildkitd is.
+type Buildkit struct{}
+
+func (b *Buildkit) Build(ctx context.Context, opts Options) (Result, error) {
+	metadataFileHandle, err := ioutil.TempFile("", "buildctl-metadata-*.json")
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to create buildctl metadata file")
+	}
+	metadataFile := metadataFileHandle.Name()
+	metadataFileHandle.Close()
+
+	args := []string{
+		"build",
+		"--frontend", "dockerfile.v0",
+		"--local", fmt.Sprintf("context=%s", opts.Context),
+		"--local", fmt.Sprintf("dockerfile=%s", dockerfileDir(opts)),
+		"--opt", fmt.Sprintf("filename=%s", path.Base(opts.Dockerfile)),
+		"--metadata-file", metadataFile,
+	}
+
+	if opts.Target != "" {
+		args = append(args, "--opt", fmt.Sprintf("target=%s", opts.Target))
+	}
+	for _, buildArg := range opts.Args {
+		args = append(args, "--opt", fmt.Sprintf("build-arg:%s", buildArg))
+	}
+	for _, label := range opts.Labels {
+		args = append(args, "--opt", fmt.Sprintf("label:%s", label))
+	}
+	if opts.CacheRepo != "" {
+		args = append(args, "--export-cache", fmt.Sprintf("type=registry,ref=%s", opts.CacheRepo))
+		args = append(args, "--import-cache", fmt.Sprintf("type=registry,ref=%s", opts.CacheRepo))
+	}
+	if opts.Verbosity != "" {
+		args = append(args, "--debug")
+	}
+
+	if !opts.NoPush {
+		for _, tag := range opts.Tags {
+			args = append(args, "--output", fmt.Sprintf("type=image,name=%s:%s,push=true", opts.Repo, tag))
+		}
+	} else {
+		args = append(args, "--output", "type=image,push=false")
+	}
+
+	cmd := exec.CommandContext(ctx, "buildctl", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return Result{}, errors.Wrap(err, fmt.Sprintf("buildctl build failed: %s", stderr.String()))
+	}
+
+	if opts.NoPush {
+		return Result{Tags: opts.Tags}, nil
+	}
+
+	digest, err := digestFromMetadataFile(metadataFile)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Digest: digest, Tags: opts.Tags}, nil
+}
+
+// dockerfileDir is the local mount buildctl reads the Dockerfile from: opts.Context joined with
+// whatever directory component opts.Dockerfile has, so a non-default Dockerfile location (e.g.
+// docker/Dockerfile) resolves relative to the build context rather than being used as-is.
+func dockerfileDir(opts Options) string {
+	if idx := strings.LastIndex(opts.Dockerfile, "/"); idx != -1 {
+		return path.Join(opts.Context, opts.Dockerfile[:idx])
+	}
+	return opts.Context
+}
+
+func digestFromMetadataFile(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read buildctl metadata file")
+	}
+
+	var metadata struct {
+		ContainerImageDigest string `json:"containerimage.digest"`
+	}
+	if err := json.Unmarshal(contents, &metadata); err != nil {
+		return "", errors.Wrap(err, "failed to parse buildctl metadata file")
+	}
+	if metadata.ContainerImageDigest == "" {
+		return "", errors.New("buildctl metadata file has no containerimage.digest")
+	}
+	return metadata.ContainerImageDigest, nil
+}
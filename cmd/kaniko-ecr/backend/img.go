@@ -0,0 +1,86 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Img drives the rootless `img` builder, another fuse-free alternative to kaniko.
+type Img struct{}
+
+var imgDigestPattern = regexp.MustCompile(`sha256:[0-9a-f]{64}`)
+
+func (i *Img) Build(ctx context.Context, opts Options) (Result, error) {
+	buildArgs := []string{"build", "-f", opts.Dockerfile}
+	if opts.Target != "" {
+		buildArgs = append(buildArgs, "--target", opts.Target)
+	}
+	for _, buildArg := range opts.Args {
+		buildArgs = append(buildArgs, "--build-arg", buildArg)
+	}
+	for _, label := range opts.Labels {
+		buildArgs = append(buildArgs, "--label", label)
+	}
+	if len(opts.Tags) > 0 {
+		buildArgs = append(buildArgs, "-t", fmt.Sprintf("%s:%s", opts.Repo, opts.Tags[0]))
+	}
+	buildArgs = append(buildArgs, opts.Context)
+
+	if err := run(ctx, "img", buildArgs...); err != nil {
+		return Result{}, errors.Wrap(err, "img build failed")
+	}
+
+	if len(opts.Tags) > 1 {
+		for _, tag := range opts.Tags[1:] {
+			if err := run(ctx, "img", "tag", fmt.Sprintf("%s:%s", opts.Repo, opts.Tags[0]), fmt.Sprintf("%s:%s", opts.Repo, tag)); err != nil {
+				return Result{}, errors.Wrap(err, "img tag failed")
+			}
+		}
+	}
+
+	if opts.NoPush {
+		return Result{Tags: opts.Tags}, nil
+	}
+
+	var digest string
+	for _, tag := range opts.Tags {
+		out, err := runCaptured(ctx, "img", "push", fmt.Sprintf("%s:%s", opts.Repo, tag))
+		if err != nil {
+			return Result{}, errors.Wrap(err, "img push failed")
+		}
+		if match := imgDigestPattern.FindString(out); match != "" {
+			digest = match
+		}
+	}
+	if digest == "" {
+		return Result{}, errors.New("img push did not report an image digest")
+	}
+
+	return Result{Digest: digest, Tags: opts.Tags}, nil
+}
+
+func run(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %s", err, stderr.String())
+	}
+	return nil
+}
+
+func runCaptured(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %s", err, stderr.String())
+	}
+	return stdout.String(), nil
+}
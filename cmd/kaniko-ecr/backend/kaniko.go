@@ -0,0 +1,57 @@
+package backend
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+
+	kaniko "github.com/drone/drone-kaniko"
+	"github.com/pkg/errors"
+)
+
+// Kaniko runs the build through the vendored kaniko executor. This is the plugin's original,
+// default behaviour.
+type Kaniko struct{}
+
+func (k *Kaniko) Build(_ context.Context, opts Options) (Result, error) {
+	plugin := kaniko.Plugin{
+		Build: kaniko.Build{
+			Dockerfile:   opts.Dockerfile,
+			Context:      opts.Context,
+			Tags:         opts.Tags,
+			Args:         opts.Args,
+			Target:       opts.Target,
+			Repo:         opts.Repo,
+			Labels:       opts.Labels,
+			SnapshotMode: opts.SnapshotMode,
+			CacheRepo:    opts.CacheRepo,
+			EnableCache:  opts.CacheRepo != "",
+			CacheTTL:     opts.CacheTTL,
+			DigestFile:   opts.DigestFile,
+			NoPush:       opts.NoPush,
+			Verbosity:    opts.Verbosity,
+		},
+	}
+
+	if err := plugin.Exec(); err != nil {
+		return Result{}, errors.Wrap(err, "kaniko build failed")
+	}
+
+	if opts.NoPush {
+		return Result{Tags: opts.Tags}, nil
+	}
+
+	digest, err := readDigestFile(opts.DigestFile)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Digest: digest, Tags: opts.Tags}, nil
+}
+
+func readDigestFile(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read digest file")
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
@@ -2,18 +2,23 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/aws/smithy-go"
-	kaniko "github.com/drone/drone-kaniko"
 	"github.com/drone/drone-kaniko/cmd/artifact"
+	"github.com/drone/drone-kaniko/cmd/kaniko-ecr/backend"
+	"github.com/drone/drone-kaniko/cmd/kaniko-ecr/sign"
 	"github.com/joho/godotenv"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -23,10 +28,12 @@ import (
 const (
 	accessKeyEnv     string = "AWS_ACCESS_KEY_ID"
 	secretKeyEnv     string = "AWS_SECRET_ACCESS_KEY"
+	sessionTokenEnv  string = "AWS_SESSION_TOKEN"
 	dockerConfigPath string = "/kaniko/.docker/config.json"
 	ecrPublicDomain  string = "public.ecr.aws"
 
-	defaultDigestFile string = "/kaniko/digest-file"
+	defaultDigestFile            string = "/kaniko/digest-file"
+	defaultAssumeRoleSessionName string = "drone-kaniko-ecr"
 )
 
 var (
@@ -112,6 +119,27 @@ func main() {
 			Usage:  "ECR secret key",
 			EnvVar: "PLUGIN_SECRET_KEY",
 		},
+		cli.StringFlag{
+			Name:   "assume-role-arn",
+			Usage:  "ARN of an IAM role to assume before talking to ECR",
+			EnvVar: "PLUGIN_ASSUME_ROLE_ARN",
+		},
+		cli.StringFlag{
+			Name:   "assume-role-session-name",
+			Usage:  "Session name to use when assuming assume-role-arn",
+			Value:  defaultAssumeRoleSessionName,
+			EnvVar: "PLUGIN_ASSUME_ROLE_SESSION_NAME",
+		},
+		cli.StringFlag{
+			Name:   "external-id",
+			Usage:  "External ID to pass when assuming assume-role-arn",
+			EnvVar: "PLUGIN_EXTERNAL_ID",
+		},
+		cli.StringFlag{
+			Name:   "web-identity-token-file",
+			Usage:  "Path to a web-identity (OIDC/IRSA) token file to use with assume-role-arn",
+			EnvVar: "PLUGIN_OIDC_TOKEN_FILE",
+		},
 		cli.StringFlag{
 			Name:   "snapshot-mode",
 			Usage:  "Specify one of full, redo or time as snapshot mode",
@@ -127,6 +155,11 @@ func main() {
 			Usage:  "Path to repository policy file",
 			EnvVar: "PLUGIN_REPOSITORY_POLICY",
 		},
+		cli.BoolFlag{
+			Name:   "append-policies",
+			Usage:  "Merge lifecycle/repository policies into whatever is already set on the repository instead of overwriting it",
+			EnvVar: "PLUGIN_APPEND_POLICIES",
+		},
 		cli.BoolFlag{
 			Name:   "enable-cache",
 			Usage:  "Set this flag to opt into caching with kaniko",
@@ -157,6 +190,47 @@ func main() {
 			Usage:  "Set this flag with value as oneof <panic|fatal|error|warn|info|debug|trace> to set the logging level for kaniko. Defaults to info.",
 			EnvVar: "PLUGIN_VERBOSITY",
 		},
+		cli.StringFlag{
+			Name:   "builder",
+			Usage:  "Build backend to use: kaniko, buildkit or img",
+			Value:  "kaniko",
+			EnvVar: "PLUGIN_BUILDER",
+		},
+		cli.BoolFlag{
+			Name:   "sign",
+			Usage:  "Sign the pushed image with cosign and, if --attest-provenance is set, attach a SLSA provenance attestation",
+			EnvVar: "PLUGIN_SIGN",
+		},
+		cli.StringFlag{
+			Name:   "cosign-key",
+			Usage:  "Path to a cosign private key to sign with; omit for keyless (OIDC) signing",
+			EnvVar: "PLUGIN_COSIGN_KEY",
+		},
+		cli.StringFlag{
+			Name:   "cosign-identity-token",
+			Usage:  "OIDC identity token to use for keyless cosign signing",
+			EnvVar: "PLUGIN_COSIGN_IDENTITY_TOKEN",
+		},
+		cli.BoolFlag{
+			Name:   "attest-provenance",
+			Usage:  "Emit a SLSA v1.0 provenance attestation alongside the cosign signature",
+			EnvVar: "PLUGIN_ATTEST_PROVENANCE",
+		},
+		cli.StringFlag{
+			Name:   "pull-through-cache-upstream",
+			Usage:  "Upstream registry to pull base images through an ECR pull-through cache rule (e.g. public.ecr.aws, quay.io, registry-1.docker.io, ghcr.io)",
+			EnvVar: "PLUGIN_PULLTHROUGH_UPSTREAM",
+		},
+		cli.StringFlag{
+			Name:   "pull-through-cache-prefix",
+			Usage:  "ECR repository prefix the pull-through cache rule is registered under",
+			EnvVar: "PLUGIN_PULLTHROUGH_PREFIX",
+		},
+		cli.StringFlag{
+			Name:   "pull-through-cache-credential-arn",
+			Usage:  "ARN of the Secrets Manager secret holding upstream registry credentials, for upstreams that require auth",
+			EnvVar: "PLUGIN_PULLTHROUGH_CREDENTIAL_ARN",
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -168,29 +242,48 @@ func run(c *cli.Context) error {
 	repo := c.String("repo")
 	registry := c.String("registry")
 	region := c.String("region")
-	accessKey := c.String("access-key")
+	assumeRoleArn := c.String("assume-role-arn")
+	accessKey := getenv(c.String("access-key"), "ECR_ACCESS_KEY", accessKeyEnv)
+	secretKey := getenv(c.String("secret-key"), "ECR_SECRET_KEY", secretKeyEnv)
 	noPush := c.Bool("no-push")
 
+	cfg, err := resolveAWSConfig(context.Background(), region, assumeRoleArn, c.String("assume-role-session-name"), c.String("external-id"), c.String("web-identity-token-file"))
+	if err != nil {
+		return err
+	}
+
+	// resolveAWSConfig has already exported the assumed role's temporary credentials into
+	// accessKeyEnv/secretKeyEnv; don't let the pre-assume-role static credentials (e.g. the
+	// long-lived base identity used to call sts:AssumeRole) overwrite them below, or the
+	// ecr-login credential helper used for the actual push ends up authenticating as the base
+	// identity instead of the assumed role.
+	if assumeRoleArn != "" {
+		accessKey = ""
+		secretKey = ""
+	}
+
 	// only setup auth when pushing or credentials are defined
 	if !noPush || accessKey != "" {
-		if err := setupECRAuth(accessKey, c.String("secret-key"), registry); err != nil {
+		if err := setupECRAuth(accessKey, secretKey, registry); err != nil {
 			return err
 		}
 	}
 
 	// only create repository when pushing and create-repository is true
 	if !noPush && c.Bool("create-repository") {
-		if err := createRepository(region, repo, registry); err != nil {
+		if err := createRepository(cfg, repo, registry); err != nil {
 			return err
 		}
 	}
 
+	appendPolicies := c.Bool("append-policies")
+
 	if c.IsSet("lifecycle-policy") {
 		contents, err := ioutil.ReadFile(c.String("lifecycle-policy"))
 		if err != nil {
 			logrus.Fatal(err)
 		}
-		if err := uploadLifeCyclePolicy(region, repo, string(contents)); err != nil {
+		if err := uploadLifeCyclePolicy(cfg, repo, string(contents), appendPolicies); err != nil {
 			logrus.Fatal(fmt.Sprintf("error uploading ECR lifecycle policy: %v", err))
 		}
 	}
@@ -200,37 +293,181 @@ func run(c *cli.Context) error {
 		if err != nil {
 			logrus.Fatal(err)
 		}
-		if err := uploadRepositoryPolicy(region, repo, registry, string(contents)); err != nil {
+		if err := uploadRepositoryPolicy(cfg, repo, registry, string(contents), appendPolicies); err != nil {
 			logrus.Fatal(fmt.Sprintf("error uploading ECR lifecycle policy: %v", err))
 		}
 	}
 
-	plugin := kaniko.Plugin{
-		Build: kaniko.Build{
-			Dockerfile:   c.String("dockerfile"),
-			Context:      c.String("context"),
-			Tags:         c.StringSlice("tags"),
-			Args:         c.StringSlice("args"),
-			Target:       c.String("target"),
-			Repo:         fmt.Sprintf("%s/%s", c.String("registry"), c.String("repo")),
-			Labels:       c.StringSlice("custom-labels"),
-			SnapshotMode: c.String("snapshot-mode"),
-			EnableCache:  c.Bool("enable-cache"),
-			CacheRepo:    fmt.Sprintf("%s/%s", c.String("registry"), c.String("cache-repo")),
-			CacheTTL:     c.Int("cache-ttl"),
-			DigestFile:   defaultDigestFile,
-			NoPush:       noPush,
-			Verbosity:    c.String("verbosity"),
-		},
-		Artifact: kaniko.Artifact{
-			Tags:         c.StringSlice("tags"),
-			Repo:         c.String("repo"),
-			Registry:     c.String("registry"),
-			ArtifactFile: c.String("artifact-file"),
-			RegistryType: artifact.ECR,
-		},
-	}
-	return plugin.Exec()
+	cacheRepo := ""
+	if c.Bool("enable-cache") {
+		cacheRepo = fmt.Sprintf("%s/%s", c.String("registry"), c.String("cache-repo"))
+	}
+
+	buildArgs := c.StringSlice("args")
+	if upstream := c.String("pull-through-cache-upstream"); upstream != "" {
+		prefix := c.String("pull-through-cache-prefix")
+		if err := ensurePullThroughCacheRule(cfg, upstream, prefix, c.String("pull-through-cache-credential-arn")); err != nil {
+			return err
+		}
+		buildArgs = append(buildArgs, fmt.Sprintf("BASE_REGISTRY=%s/%s", registry, prefix))
+	}
+
+	b, err := backend.New(c.String("builder"))
+	if err != nil {
+		return err
+	}
+
+	result, err := b.Build(context.Background(), backend.Options{
+		Dockerfile:   c.String("dockerfile"),
+		Context:      c.String("context"),
+		Tags:         c.StringSlice("tags"),
+		Args:         buildArgs,
+		Target:       c.String("target"),
+		Repo:         fmt.Sprintf("%s/%s", c.String("registry"), c.String("repo")),
+		Labels:       c.StringSlice("custom-labels"),
+		SnapshotMode: c.String("snapshot-mode"),
+		CacheRepo:    cacheRepo,
+		CacheTTL:     c.Int("cache-ttl"),
+		NoPush:       noPush,
+		Verbosity:    c.String("verbosity"),
+		DigestFile:   defaultDigestFile,
+	})
+	if err != nil {
+		return err
+	}
+
+	artifactFile := c.String("artifact-file")
+	if artifactFile != "" {
+		if err := artifact.WritePluginArtifactFile(artifact.ECR, artifactFile, c.String("registry"), c.String("repo"), result.Tags, result.Digest); err != nil {
+			return err
+		}
+	}
+
+	if c.Bool("sign") && !noPush {
+		if result.Digest == "" {
+			return fmt.Errorf("cannot sign: no digest returned by the %s backend", c.String("builder"))
+		}
+
+		signResult, err := sign.Sign(context.Background(), sign.Options{
+			Reference:        fmt.Sprintf("%s/%s@%s", c.String("registry"), repo, result.Digest),
+			Key:              c.String("cosign-key"),
+			IdentityToken:    c.String("cosign-identity-token"),
+			AttestProvenance: c.Bool("attest-provenance"),
+			BuildLink:        os.Getenv("DRONE_BUILD_LINK"),
+			CommitSHA:        os.Getenv("DRONE_COMMIT"),
+			GitRemote:        os.Getenv("DRONE_REMOTE_URL"),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to sign image")
+		}
+
+		if artifactFile != "" {
+			if err := addSignatureDigests(artifactFile, signResult); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// addSignatureDigests folds the cosign signature/attestation digests into the artifact file that
+// artifact.WritePluginArtifactFile already wrote, alongside the image digest.
+func addSignatureDigests(artifactFile string, signResult sign.Result) error {
+	contents, err := ioutil.ReadFile(artifactFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read artifact file")
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(contents, &doc); err != nil {
+		return errors.Wrap(err, "failed to parse artifact file")
+	}
+
+	if signResult.SignatureDigest != "" {
+		doc["signature_digest"] = signResult.SignatureDigest
+	}
+	if signResult.AttestationDigest != "" {
+		doc["attestation_digest"] = signResult.AttestationDigest
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return errors.Wrap(err, "failed to serialise artifact file")
+	}
+	return ioutil.WriteFile(artifactFile, out, 0644)
+}
+
+// getenv returns explicit if it is non-empty, otherwise the first non-empty value among the
+// fallback environment variables. This lets pipelines migrating from other ECR plugins reuse
+// their existing secret names instead of renaming them to PLUGIN_ACCESS_KEY/PLUGIN_SECRET_KEY.
+func getenv(explicit string, fallbacks ...string) string {
+	if explicit != "" {
+		return explicit
+	}
+	for _, name := range fallbacks {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// resolveAWSConfig loads the default AWS config for region and, if assumeRoleArn is set, swaps in
+// temporary credentials obtained by assuming that role - via web identity (IRSA) federation when
+// webIdentityTokenFile is supplied, or a direct AssumeRole call otherwise. The resulting
+// credentials are also exported to the environment so the kaniko/docker credential helper picks
+// them up.
+func resolveAWSConfig(ctx context.Context, region, assumeRoleArn, sessionName, externalID, webIdentityTokenFile string) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return aws.Config{}, errors.Wrap(err, "failed to load aws config")
+	}
+
+	if assumeRoleArn == "" {
+		return cfg, nil
+	}
+
+	if sessionName == "" {
+		sessionName = defaultAssumeRoleSessionName
+	}
+
+	stsSvc := sts.NewFromConfig(cfg)
+
+	var provider aws.CredentialsProvider
+	if webIdentityTokenFile != "" {
+		provider = stscreds.NewWebIdentityRoleProvider(stsSvc, assumeRoleArn, stscreds.IdentityTokenFile(webIdentityTokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+			o.RoleSessionName = sessionName
+		})
+	} else {
+		provider = stscreds.NewAssumeRoleProvider(stsSvc, assumeRoleArn, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = sessionName
+			if externalID != "" {
+				o.ExternalID = aws.String(externalID)
+			}
+		})
+	}
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return aws.Config{}, errors.Wrap(err, "failed to assume role "+assumeRoleArn)
+	}
+
+	for name, value := range map[string]string{
+		accessKeyEnv:    creds.AccessKeyID,
+		secretKeyEnv:    creds.SecretAccessKey,
+		sessionTokenEnv: creds.SessionToken,
+	} {
+		if value == "" {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return aws.Config{}, errors.Wrap(err, fmt.Sprintf("failed to set %s environment variable", name))
+		}
+	}
+
+	return cfg, nil
 }
 
 func setupECRAuth(accessKey, secretKey, registry string) error {
@@ -259,7 +496,7 @@ func setupECRAuth(accessKey, secretKey, registry string) error {
 	return nil
 }
 
-func createRepository(region, repo, registry string) error {
+func createRepository(cfg aws.Config, repo, registry string) error {
 	if registry == "" {
 		return fmt.Errorf("registry must be specified")
 	}
@@ -268,11 +505,6 @@ func createRepository(region, repo, registry string) error {
 		return fmt.Errorf("repo must be specified")
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
-	if err != nil {
-		return errors.Wrap(err, "failed to load aws config")
-	}
-
 	var createErr error
 
 	//create public repo
@@ -294,14 +526,58 @@ func createRepository(region, repo, registry string) error {
 	return nil
 }
 
-func uploadLifeCyclePolicy(region, repo, lifecyclePolicy string) (err error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
-	if err != nil {
-		return errors.Wrap(err, "failed to load aws config")
+// ensurePullThroughCacheRule wires upstream up as a pull-through cache under prefix, so base image
+// pulls against that prefix are transparently proxied and cached by ECR. credentialArn is only
+// required for upstreams that need authentication (e.g. a rate-limited Docker Hub account).
+func ensurePullThroughCacheRule(cfg aws.Config, upstream, prefix, credentialArn string) error {
+	if upstream == "" {
+		return fmt.Errorf("pull-through-cache-upstream must be specified")
+	}
+	if prefix == "" {
+		return fmt.Errorf("pull-through-cache-prefix must be specified")
+	}
+
+	svc := ecr.NewFromConfig(cfg)
+
+	input := &ecr.CreatePullThroughCacheRuleInput{
+		EcrRepositoryPrefix: aws.String(prefix),
+		UpstreamRegistryUrl: aws.String(upstream),
+	}
+	if credentialArn != "" {
+		input.CredentialArn = aws.String(credentialArn)
+	}
+
+	_, err := svc.CreatePullThroughCacheRule(context.TODO(), input)
+
+	var apiError smithy.APIError
+	if errors.As(err, &apiError) && apiError.ErrorCode() != "PullThroughCacheRuleAlreadyExistsException" {
+		return errors.Wrap(err, "failed to create pull-through cache rule")
 	}
 
+	return nil
+}
+
+func uploadLifeCyclePolicy(cfg aws.Config, repo, lifecyclePolicy string, appendPolicy bool) (err error) {
 	svc := ecr.NewFromConfig(cfg)
 
+	if appendPolicy {
+		existing, getErr := svc.GetLifecyclePolicy(context.TODO(), &ecr.GetLifecyclePolicyInput{RepositoryName: aws.String(repo)})
+		var apiError smithy.APIError
+		if getErr != nil && !errors.As(getErr, &apiError) {
+			return errors.Wrap(getErr, "failed to fetch existing lifecycle policy")
+		}
+		if getErr != nil && apiError.ErrorCode() != "LifecyclePolicyNotFoundException" {
+			return errors.Wrap(getErr, "failed to fetch existing lifecycle policy")
+		}
+		if getErr == nil {
+			merged, mergeErr := mergeLifecyclePolicies(aws.ToString(existing.LifecyclePolicyText), lifecyclePolicy)
+			if mergeErr != nil {
+				return errors.Wrap(mergeErr, "failed to merge lifecycle policies")
+			}
+			lifecyclePolicy = merged
+		}
+	}
+
 	input := &ecr.PutLifecyclePolicyInput{
 		LifecyclePolicyText: aws.String(lifecyclePolicy),
 		RepositoryName:      aws.String(repo),
@@ -311,15 +587,23 @@ func uploadLifeCyclePolicy(region, repo, lifecyclePolicy string) (err error) {
 	return err
 }
 
-func uploadRepositoryPolicy(region, repo, registry, repositoryPolicy string) (err error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
-	if err != nil {
-		return errors.Wrap(err, "failed to load aws config")
-	}
-
+func uploadRepositoryPolicy(cfg aws.Config, repo, registry, repositoryPolicy string, appendPolicy bool) (err error) {
 	if isRegistryPublic(registry) {
 		svc := ecrpublic.NewFromConfig(cfg)
 
+		if appendPolicy {
+			repositoryPolicy, err = appendRepositoryPolicy(repositoryPolicy, func() (string, error) {
+				out, getErr := svc.GetRepositoryPolicy(context.TODO(), &ecrpublic.GetRepositoryPolicyInput{RepositoryName: aws.String(repo)})
+				if getErr != nil {
+					return "", getErr
+				}
+				return aws.ToString(out.PolicyText), nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
 		input := &ecrpublic.SetRepositoryPolicyInput{
 			PolicyText:     aws.String(repositoryPolicy),
 			RepositoryName: aws.String(repo),
@@ -329,6 +613,19 @@ func uploadRepositoryPolicy(region, repo, registry, repositoryPolicy string) (er
 
 		svc := ecr.NewFromConfig(cfg)
 
+		if appendPolicy {
+			repositoryPolicy, err = appendRepositoryPolicy(repositoryPolicy, func() (string, error) {
+				out, getErr := svc.GetRepositoryPolicy(context.TODO(), &ecr.GetRepositoryPolicyInput{RepositoryName: aws.String(repo)})
+				if getErr != nil {
+					return "", getErr
+				}
+				return aws.ToString(out.PolicyText), nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
 		input := &ecr.SetRepositoryPolicyInput{
 			PolicyText:     aws.String(repositoryPolicy),
 			RepositoryName: aws.String(repo),
@@ -339,6 +636,128 @@ func uploadRepositoryPolicy(region, repo, registry, repositoryPolicy string) (er
 	return err
 }
 
+// appendRepositoryPolicy fetches the repository's current policy via get and merges it with
+// newPolicy, falling back to newPolicy unmodified if no policy exists yet (404/ResourceNotFoundException).
+func appendRepositoryPolicy(newPolicy string, get func() (string, error)) (string, error) {
+	existing, getErr := get()
+	if getErr != nil {
+		var apiError smithy.APIError
+		if errors.As(getErr, &apiError) && (apiError.ErrorCode() == "RepositoryPolicyNotFoundException" || apiError.ErrorCode() == "ResourceNotFoundException") {
+			return newPolicy, nil
+		}
+		return "", errors.Wrap(getErr, "failed to fetch existing repository policy")
+	}
+
+	merged, mergeErr := mergeRepositoryPolicies(existing, newPolicy)
+	if mergeErr != nil {
+		return "", errors.Wrap(mergeErr, "failed to merge repository policies")
+	}
+	return merged, nil
+}
+
+type lifecycleRule struct {
+	RulePriority int                    `json:"rulePriority"`
+	Description  string                 `json:"description,omitempty"`
+	Selection    map[string]interface{} `json:"selection"`
+	Action       map[string]interface{} `json:"action"`
+}
+
+type lifecyclePolicyDoc struct {
+	Rules []lifecycleRule `json:"rules"`
+}
+
+// mergeLifecyclePolicies unions the rules of existing and incoming, replacing any existing rule
+// that shares a description and selection with an incoming one, and renumbers rulePriority
+// monotonically so there are no collisions.
+func mergeLifecyclePolicies(existing, incoming string) (string, error) {
+	var existingDoc, incomingDoc lifecyclePolicyDoc
+	if err := json.Unmarshal([]byte(existing), &existingDoc); err != nil {
+		return "", errors.Wrap(err, "failed to parse existing lifecycle policy")
+	}
+	if err := json.Unmarshal([]byte(incoming), &incomingDoc); err != nil {
+		return "", errors.Wrap(err, "failed to parse new lifecycle policy")
+	}
+
+	ruleKey := func(r lifecycleRule) string {
+		selection, _ := json.Marshal(r.Selection)
+		return r.Description + "|" + string(selection)
+	}
+
+	merged := make([]lifecycleRule, 0, len(existingDoc.Rules)+len(incomingDoc.Rules))
+	replaced := make(map[string]bool, len(incomingDoc.Rules))
+	for _, r := range incomingDoc.Rules {
+		replaced[ruleKey(r)] = true
+	}
+	for _, r := range existingDoc.Rules {
+		if replaced[ruleKey(r)] {
+			continue
+		}
+		merged = append(merged, r)
+	}
+	merged = append(merged, incomingDoc.Rules...)
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].RulePriority < merged[j].RulePriority })
+	for i := range merged {
+		merged[i].RulePriority = i + 1
+	}
+
+	out, err := json.Marshal(lifecyclePolicyDoc{Rules: merged})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to serialise merged lifecycle policy")
+	}
+	return string(out), nil
+}
+
+type iamPolicyDoc struct {
+	Version   string                   `json:"Version,omitempty"`
+	Statement []map[string]interface{} `json:"Statement"`
+}
+
+// mergeRepositoryPolicies appends incoming's Statement entries onto existing's, deduplicating by
+// Sid: an existing statement whose Sid matches an incoming one is dropped, and the incoming
+// statements follow the remaining existing ones in their original order.
+func mergeRepositoryPolicies(existing, incoming string) (string, error) {
+	var existingDoc, incomingDoc iamPolicyDoc
+	if err := json.Unmarshal([]byte(existing), &existingDoc); err != nil {
+		return "", errors.Wrap(err, "failed to parse existing repository policy")
+	}
+	if err := json.Unmarshal([]byte(incoming), &incomingDoc); err != nil {
+		return "", errors.Wrap(err, "failed to parse new repository policy")
+	}
+
+	sidOf := func(s map[string]interface{}) (string, bool) {
+		sid, ok := s["Sid"].(string)
+		return sid, ok && sid != ""
+	}
+
+	replaced := make(map[string]bool, len(incomingDoc.Statement))
+	for _, s := range incomingDoc.Statement {
+		if sid, ok := sidOf(s); ok {
+			replaced[sid] = true
+		}
+	}
+
+	merged := make([]map[string]interface{}, 0, len(existingDoc.Statement)+len(incomingDoc.Statement))
+	for _, s := range existingDoc.Statement {
+		if sid, ok := sidOf(s); ok && replaced[sid] {
+			continue
+		}
+		merged = append(merged, s)
+	}
+	merged = append(merged, incomingDoc.Statement...)
+
+	version := existingDoc.Version
+	if version == "" {
+		version = incomingDoc.Version
+	}
+
+	out, err := json.Marshal(iamPolicyDoc{Version: version, Statement: merged})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to serialise merged repository policy")
+	}
+	return string(out), nil
+}
+
 func isRegistryPublic(registry string) bool {
 	return strings.HasPrefix(registry, ecrPublicDomain)
 }
@@ -0,0 +1,137 @@
+// Package sign signs a pushed image with cosign and, optionally, attaches a SLSA provenance
+// attestation, reusing the ECR credential helper the plugin already wired up for the build push.
+package sign
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/sigstore/cosign/v2/pkg/oci/static"
+)
+
+// Options configures the signing pass run after a successful build+push.
+type Options struct {
+	// Reference is the full registry/repo@sha256:... that was just pushed.
+	Reference string
+
+	// Key is a path to a cosign private key. Empty selects keyless (OIDC) signing.
+	Key string
+	// IdentityToken is the OIDC identity token used for keyless signing.
+	IdentityToken string
+
+	AttestProvenance bool
+
+	// Provenance inputs, sourced from the Drone environment.
+	BuildLink string // DRONE_BUILD_LINK
+	CommitSHA string // DRONE_COMMIT
+	GitRemote string
+}
+
+// Result reports the digests of whatever was uploaded, so the caller can fold them into the
+// plugin's artifact file.
+type Result struct {
+	SignatureDigest   string
+	AttestationDigest string
+}
+
+// Sign signs opts.Reference and, if requested, attaches a provenance attestation, uploading both
+// using cosign's usual tag convention (sha256-<digest>.sig / .att) on the same repository.
+func Sign(ctx context.Context, opts Options) (Result, error) {
+	ref, err := name.ParseReference(opts.Reference)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to parse image reference")
+	}
+	digest, ok := ref.(name.Digest)
+	if !ok {
+		return Result{}, errors.New("reference must be pinned to a digest")
+	}
+
+	signer, err := newSigner(ctx, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	payload, err := simpleSigningPayload(digest)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to build signature payload")
+	}
+
+	sig, err := signer.SignMessage(bytes.NewReader(payload))
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to sign image")
+	}
+
+	sigTag, err := static.NewSignature(payload, base64.StdEncoding.EncodeToString(sig))
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to build signature layer")
+	}
+
+	sigDigest, err := uploadTagged(ctx, digest, sigTag, ".sig")
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to upload signature")
+	}
+
+	result := Result{SignatureDigest: sigDigest}
+
+	if opts.AttestProvenance {
+		predicate := provenancePredicate(opts)
+		attDigest, err := attest(ctx, digest, signer, predicate)
+		if err != nil {
+			return Result{}, errors.Wrap(err, "failed to attest image")
+		}
+		result.AttestationDigest = attDigest
+	}
+
+	return result, nil
+}
+
+// simpleSigningPayload builds the "simple signing" payload cosign signs over: the repository's
+// docker reference plus the pinned manifest digest.
+func simpleSigningPayload(digest name.Digest) ([]byte, error) {
+	type critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	}
+
+	var payload struct {
+		Critical critical          `json:"critical"`
+		Type     string            `json:"type"`
+		Optional map[string]string `json:"optional,omitempty"`
+	}
+	payload.Critical.Identity.DockerReference = digest.Repository.Name()
+	payload.Critical.Image.DockerManifestDigest = digest.DigestStr()
+	payload.Type = "cosign container image signature"
+
+	return json.Marshal(payload)
+}
+
+func tagFor(digest name.Digest, suffix string) (name.Tag, error) {
+	// cosign's convention: sha256:abcd... -> sha256-abcd....sig / .att
+	encoded := digest.DigestStr()
+	tagged := fmt.Sprintf("%s:%s%s", digest.Repository.Name(), stripAlgoColon(encoded), suffix)
+	return name.NewTag(tagged)
+}
+
+func stripAlgoColon(digest string) string {
+	out := []byte(digest)
+	for i, c := range out {
+		if c == ':' {
+			out[i] = '-'
+		}
+	}
+	return string(out)
+}
+
+func keychain() authn.Keychain {
+	return authn.DefaultKeychain
+}
@@ -0,0 +1,30 @@
+package sign
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
+	cosignsign "github.com/sigstore/cosign/v2/cmd/cosign/cli/sign"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+// newSigner resolves a signature.Signer from either a cosign key file or, when none is given, a
+// keyless identity: cosign's own SignerFromKeyOpts exchanges opts.IdentityToken with Fulcio for a
+// short-lived signing certificate and wraps the resulting ephemeral key in the same
+// signature.SignerVerifier cosign's CLI itself signs with, so the Fulcio/Rekor plumbing doesn't
+// need to be reimplemented here.
+func newSigner(ctx context.Context, opts Options) (signature.Signer, error) {
+	if opts.Key == "" && opts.IdentityToken == "" {
+		return nil, errors.New("either --cosign-key or --cosign-identity-token must be set to sign")
+	}
+
+	sv, err := cosignsign.SignerFromKeyOpts(ctx, "", "", options.KeyOpts{
+		KeyRef:  opts.Key,
+		IDToken: opts.IdentityToken,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve cosign signer")
+	}
+	return sv, nil
+}
@@ -0,0 +1,37 @@
+package sign
+
+import (
+	"context"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+)
+
+// uploadTagged pushes layer (a signature or attestation) as a single-layer image tagged with
+// cosign's sha256-<digest><suffix> convention, on the signed image's own repository, reusing the
+// ECR credential helper already wired up for the build push.
+func uploadTagged(ctx context.Context, digest name.Digest, layer v1.Layer, suffix string) (string, error) {
+	tag, err := tagFor(digest, suffix)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build cosign tag")
+	}
+
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build signature image")
+	}
+
+	if err := remote.Write(tag, img, remote.WithContext(ctx), remote.WithAuthFromKeychain(keychain())); err != nil {
+		return "", errors.Wrap(err, "failed to push "+tag.String())
+	}
+
+	h, err := img.Digest()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to compute pushed digest")
+	}
+	return h.String(), nil
+}